@@ -0,0 +1,63 @@
+package execution
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mrochk/exchange/orderbook"
+)
+
+/*
+Manager tracks every TWAPExecutor started against an OrderBook
+so the server can look one up or cancel it by id after Start has
+returned. Mirrors how server.wsHub keeps its clients in a
+mutex-protected map.
+*/
+type Manager struct {
+	ob *orderbook.OrderBook
+
+	mu        sync.Mutex
+	executors map[uuid.UUID]*TWAPExecutor
+}
+
+func NewManager(ob *orderbook.OrderBook) *Manager {
+	return &Manager{ob: ob, executors: make(map[uuid.UUID]*TWAPExecutor)}
+}
+
+/*
+Start creates a TWAPExecutor for the given parent order, starts
+it, and registers it so it can be looked up by id afterwards.
+*/
+func (m *Manager) Start(buyOrder bool, qty float64, slices int, interval time.Duration) (*TWAPExecutor, error) {
+	e, err := New(m.ob, buyOrder, qty, slices, interval)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	m.executors[e.ID()] = e
+	m.mu.Unlock()
+
+	e.Start()
+	return e, nil
+}
+
+// Get returns the executor registered under id, if any.
+func (m *Manager) Get(id uuid.UUID) (*TWAPExecutor, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.executors[id]
+	return e, ok
+}
+
+// Cancel stops the executor registered under id. Reports
+// whether an executor was found.
+func (m *Manager) Cancel(id uuid.UUID) bool {
+	e, ok := m.Get(id)
+	if !ok {
+		return false
+	}
+	e.Cancel()
+	return true
+}
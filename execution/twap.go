@@ -0,0 +1,269 @@
+/*
+Package execution implements algorithmic order types built on
+top of the matching engine exposed by orderbook.OrderBook. The
+first primitive is TWAP, which slices a large parent order into
+smaller child orders spaced evenly over a time window so it
+doesn't move the book as much as placing the whole quantity at
+once would.
+*/
+package execution
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mrochk/exchange/orderbook"
+)
+
+/*
+Status is the lifecycle state of a TWAPExecutor.
+*/
+type Status int
+
+const (
+	StatusRunning Status = iota
+	StatusCompleted
+	StatusCancelled
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusRunning:
+		return "running"
+	case StatusCompleted:
+		return "completed"
+	case StatusCancelled:
+		return "cancelled"
+	default:
+		return "unknown"
+	}
+}
+
+/*
+Progress is a point-in-time snapshot of a TWAPExecutor's state,
+returned by GET /twap/{id}.
+*/
+type Progress struct {
+	ID           uuid.UUID         `json:"id"`
+	BuyOrder     bool              `json:"buy_order"`
+	TotalQty     float64           `json:"total_qty"`
+	FilledQty    float64           `json:"filled_qty"`
+	RemainingQty float64           `json:"remaining_qty"`
+	Slices       int               `json:"slices"`
+	SlicesDone   int               `json:"slices_done"`
+	Status       Status            `json:"status"`
+	Trades       []orderbook.Trade `json:"trades"`
+}
+
+/*
+TWAPExecutor slices a parent order of TotalQty into Slices
+child orders, one every Interval, each repriced against the
+book's current best opposite side so it stays marketable as the
+book moves. Child orders are placed IOC so an unfilled remainder
+never rests; whatever a slice doesn't fill is carried over and
+retried, repriced, at the next interval. It stops early once the
+parent is fully filled or cancelled.
+*/
+type TWAPExecutor struct {
+	id       uuid.UUID
+	ob       *orderbook.OrderBook
+	buyOrder bool
+	totalQty float64
+	sliceQty float64
+	slices   int
+	interval time.Duration
+
+	mu         sync.Mutex
+	filledQty  float64
+	slicesDone int
+	status     Status
+	trades     []orderbook.Trade
+
+	cancelCh chan struct{}
+	done     chan struct{}
+}
+
+/*
+New validates the parent order's parameters and returns a
+TWAPExecutor ready to be started. It does not place any order
+until Start is called.
+*/
+func New(ob *orderbook.OrderBook, buyOrder bool, qty float64, slices int, interval time.Duration) (*TWAPExecutor, error) {
+	if qty <= 0 {
+		return nil, errors.New("twap: qty must be > 0")
+	}
+	if slices <= 0 {
+		return nil, errors.New("twap: slices must be > 0")
+	}
+	if interval <= 0 {
+		return nil, errors.New("twap: interval must be > 0")
+	}
+	return &TWAPExecutor{
+		id:       uuid.New(),
+		ob:       ob,
+		buyOrder: buyOrder,
+		totalQty: qty,
+		sliceQty: qty / float64(slices),
+		slices:   slices,
+		interval: interval,
+		cancelCh: make(chan struct{}),
+		done:     make(chan struct{}),
+	}, nil
+}
+
+// ID identifies this execution for GET/DELETE /twap/{id}.
+func (e *TWAPExecutor) ID() uuid.UUID { return e.id }
+
+/*
+Start runs the slicing loop in its own goroutine and returns
+immediately.
+*/
+func (e *TWAPExecutor) Start() {
+	go e.run()
+}
+
+func (e *TWAPExecutor) run() {
+	defer close(e.done)
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for i := 0; i < e.slices; i++ {
+		select {
+		case <-e.cancelCh:
+			e.finish(StatusCancelled)
+			return
+		default:
+		}
+
+		e.placeSlice()
+
+		e.mu.Lock()
+		e.slicesDone++
+		done := e.filledQty >= e.totalQty
+		e.mu.Unlock()
+		if done {
+			e.finish(StatusCompleted)
+			return
+		}
+
+		if i == e.slices-1 {
+			break
+		}
+		select {
+		case <-ticker.C:
+		case <-e.cancelCh:
+			e.finish(StatusCancelled)
+			return
+		}
+	}
+
+	e.finish(StatusCompleted)
+}
+
+/*
+placeSlice submits one child order for this slice's share of the
+parent plus whatever earlier slices left unfilled, priced at the
+current best opposite limit so it crosses the book immediately,
+then reconciles the parent's filled quantity from the trades it
+produced. A slice that finds no opposite liquidity is simply
+skipped; its quantity rolls into the next interval.
+*/
+func (e *TWAPExecutor) placeSlice() {
+	e.mu.Lock()
+	due := e.sliceQty*float64(e.slicesDone+1) - e.filledQty
+	e.mu.Unlock()
+	qty := math.Min(due, e.remainingQty())
+	if qty <= 0 {
+		return
+	}
+
+	price, ok := e.bestOppositePrice()
+	if !ok {
+		return
+	}
+
+	_, trades, err := e.ob.PlaceLimitOrder(e.buyOrder, price, qty, orderbook.IOC)
+	if err != nil {
+		return
+	}
+
+	var filled float64
+	for _, t := range trades {
+		filled += t.Qty
+	}
+
+	e.mu.Lock()
+	e.filledQty += filled
+	e.trades = append(e.trades, trades...)
+	e.mu.Unlock()
+}
+
+/*
+bestOppositePrice returns the price a child order must cross to
+trade immediately: the best ask for a buy, the best bid for a
+sell.
+*/
+func (e *TWAPExecutor) bestOppositePrice() (float64, bool) {
+	buyLimits, sellLimits := e.ob.Depth(1)
+	if e.buyOrder {
+		if len(sellLimits) == 0 {
+			return 0, false
+		}
+		return sellLimits[0].Price, true
+	}
+	if len(buyLimits) == 0 {
+		return 0, false
+	}
+	return buyLimits[0].Price, true
+}
+
+func (e *TWAPExecutor) remainingQty() float64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.totalQty - e.filledQty
+}
+
+func (e *TWAPExecutor) finish(status Status) {
+	e.mu.Lock()
+	if e.status == StatusRunning {
+		e.status = status
+	}
+	e.mu.Unlock()
+}
+
+/*
+Cancel stops the executor before it places any further slices.
+Already-filled quantity is unaffected. Safe to call more than
+once or after the execution has already finished.
+*/
+func (e *TWAPExecutor) Cancel() {
+	select {
+	case <-e.cancelCh:
+	default:
+		close(e.cancelCh)
+	}
+	<-e.done
+}
+
+// Snapshot returns the executor's current progress.
+func (e *TWAPExecutor) Snapshot() Progress {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	trades := make([]orderbook.Trade, len(e.trades))
+	copy(trades, e.trades)
+	return Progress{
+		ID:           e.id,
+		BuyOrder:     e.buyOrder,
+		TotalQty:     e.totalQty,
+		FilledQty:    e.filledQty,
+		RemainingQty: e.totalQty - e.filledQty,
+		Slices:       e.slices,
+		SlicesDone:   e.slicesDone,
+		Status:       e.status,
+		Trades:       trades,
+	}
+}
@@ -0,0 +1,61 @@
+package orderbook
+
+import "github.com/google/uuid"
+
+/*
+LimitOrderReq describes a single limit order to place as part
+of a batch submitted to PlaceLimitOrders.
+*/
+type LimitOrderReq struct {
+	BuyOrder    bool
+	Price       float64
+	Qty         float64
+	TimeInForce TimeInForce
+}
+
+/*
+CancelReq describes a single limit order to cancel as part of
+a batch submitted to CancelLimitOrders.
+*/
+type CancelReq struct {
+	ID    uuid.UUID
+	Price float64
+}
+
+/*
+PlaceLimitOrders places every order in orders against the book
+and reports the outcome of each entry independently: a failure
+on one order does not prevent the others from being placed.
+Useful for market-making clients that want to submit many
+quotes without paying for a round-trip each. The whole batch runs
+under a single lock acquisition, so a concurrent market order
+can't interleave between two entries of the batch.
+*/
+func (ob *OrderBook) PlaceLimitOrders(orders []LimitOrderReq) ([]uuid.UUID, [][]Trade, []error) {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	ids := make([]uuid.UUID, len(orders))
+	trades := make([][]Trade, len(orders))
+	errs := make([]error, len(orders))
+	for i, o := range orders {
+		ids[i], trades[i], errs[i] = ob.placeLimitOrderLocked(o.BuyOrder, o.Price, o.Qty, o.TimeInForce)
+	}
+	return ids, trades, errs
+}
+
+/*
+CancelLimitOrders cancels every order in reqs and reports the
+outcome of each entry independently. The whole batch runs under a
+single lock acquisition, for the same reason as PlaceLimitOrders.
+*/
+func (ob *OrderBook) CancelLimitOrders(reqs []CancelReq) []error {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	errs := make([]error, len(reqs))
+	for i, r := range reqs {
+		errs[i] = ob.cancelLimitOrderLocked(r.ID, r.Price)
+	}
+	return errs
+}
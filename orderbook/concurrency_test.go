@@ -0,0 +1,58 @@
+package orderbook
+
+import (
+	"sync"
+	"testing"
+)
+
+/*
+TestConcurrentOrderBookAccess hammers PlaceLimitOrder,
+CancelLimitOrder and PlaceMarketOrder from many goroutines at
+once. It doesn't assert on the resulting book state -- run with
+-race, its job is to make sure the mutex added to OrderBook
+actually serializes access to the tree, maps and order queues.
+*/
+func TestConcurrentOrderBookAccess(t *testing.T) {
+	ob := New()
+	ob.Init(100)
+
+	const (
+		limitWorkers       = 50
+		opsPerWorker       = 200
+		marketWorkers      = 5
+		opsPerMarketWorker = 50
+	)
+
+	var wg sync.WaitGroup
+	wg.Add(limitWorkers + marketWorkers)
+
+	for i := 0; i < limitWorkers; i++ {
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < opsPerWorker; j++ {
+				buyOrder := (i+j)%2 == 0
+				price := 90 + float64((i+j)%20)
+
+				id, _, err := ob.PlaceLimitOrder(buyOrder, price, 1, GTC)
+				if err == nil {
+					ob.CancelLimitOrder(id, price)
+				}
+				ob.GetOrder(id)
+				ob.GetData()
+				ob.Depth(5)
+				ob.Trades(0)
+			}
+		}(i)
+	}
+
+	for i := 0; i < marketWorkers; i++ {
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < opsPerMarketWorker; j++ {
+				ob.PlaceMarketOrder((i+j)%2 == 0, 1)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+}
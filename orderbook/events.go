@@ -0,0 +1,74 @@
+package orderbook
+
+import "github.com/google/uuid"
+
+/*
+EventKind identifies what kind of book event an Event carries.
+*/
+type EventKind int
+
+const (
+	EventLimitAdded EventKind = iota
+	EventLimitRemoved
+	EventOrderPlaced
+	EventOrderCancelled
+	EventTradeExecuted
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case EventLimitAdded:
+		return "limit_added"
+	case EventLimitRemoved:
+		return "limit_removed"
+	case EventOrderPlaced:
+		return "order_placed"
+	case EventOrderCancelled:
+		return "order_cancelled"
+	case EventTradeExecuted:
+		return "trade_executed"
+	default:
+		return "unknown"
+	}
+}
+
+/*
+An Event describes an incremental change to the order-book,
+meant to be streamed to subscribers instead of having them
+poll GetData. Fields not relevant to Kind are left at their
+zero value.
+*/
+type Event struct {
+	Kind     EventKind
+	BuyOrder bool
+	Price    float64
+	Qty      float64
+	OrderID  uuid.UUID
+	MidPrice float64
+	Spread   float64
+}
+
+/*
+SetEventSink registers a callback invoked for every book event
+produced by PlaceLimitOrder, CancelLimitOrder and
+PlaceMarketOrder. Passing nil disables event publishing.
+*/
+func (ob *OrderBook) SetEventSink(sink func(Event)) {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	ob.eventSink = sink
+}
+
+/*
+emit fills in the current midprice/spread (best effort, ignored
+if the book has no quotes yet) and forwards the event to the
+registered sink, if any.
+*/
+func (ob *OrderBook) emit(e Event) {
+	if ob.eventSink == nil {
+		return
+	}
+	e.MidPrice, _ = ob.getMidPrice()
+	e.Spread, _ = ob.getSpread()
+	ob.eventSink(e)
+}
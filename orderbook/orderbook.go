@@ -3,7 +3,8 @@ package orderbook
 import (
 	"errors"
 	"fmt"
-	"sort"
+	"math"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -96,15 +97,24 @@ Deletes the order having this id from the
 order queue and keeps them ordered.
 */
 func (l *Limit) deleteOrder(id uuid.UUID) error {
+	if l.orders.front == nil {
+		return errors.New("no order having this id in this limit")
+	}
 	if l.orders.front.id == id {
 		l.Volume -= l.orders.front.qty
 		l.orders.front = l.orders.front.next
+		if l.orders.front == nil {
+			l.orders.rear = nil
+		}
 		return nil
 	}
 	temp := l.orders.front
 	for temp.next != nil {
 		if temp.next.id == id {
 			l.Volume -= temp.next.qty
+			if temp.next == l.orders.rear {
+				l.orders.rear = temp
+			}
 			temp.next = temp.next.next
 			return nil
 		}
@@ -114,16 +124,31 @@ func (l *Limit) deleteOrder(id uuid.UUID) error {
 }
 
 /*
-The order-book is simply a collection of buy and
-sell limits sitting at certain Prices and containing
-orders, we use slices and maps to access them.
+The order-book is simply a collection of buy and sell limits
+sitting at certain Prices, kept in a price-ordered tree per
+side so the best bid/ask and sorted iteration don't require
+re-sorting a slice on every mutation. buyLimitsMap/sellLimitsMap
+key limits by price tick rather than raw float64 so that
+float64 arithmetic drifting a Price by an epsilon can't produce
+a lookup miss.
 */
 type OrderBook struct {
-	BuyLimits     []*Limit
-	SellLimits    []*Limit
-	buyLimitsMap  map[float64]*Limit
-	sellLimitsMap map[float64]*Limit
+	// mu guards every field below. Every exported method locks
+	// it itself (Lock to mutate, RLock to only read) and
+	// unexported helpers assume it is already held by their
+	// caller, so they must never be called without it and must
+	// never take it themselves -- doing so would deadlock given
+	// sync.RWMutex isn't reentrant.
+	mu sync.RWMutex
+
+	buyTree       priceTree
+	sellTree      priceTree
+	buyLimitsMap  map[int64]*Limit
+	sellLimitsMap map[int64]*Limit
 	Price         float64 // Price of the limit at which the last order was executed.
+	eventSink     func(Event)
+	orders        map[uuid.UUID]*OrderInfo
+	trades        tradeRingBuffer
 }
 
 /*
@@ -133,11 +158,10 @@ initialized with the Init() function.
 */
 func New() *OrderBook {
 	return &OrderBook{
-		BuyLimits:     []*Limit{},
-		SellLimits:    []*Limit{},
-		buyLimitsMap:  make(map[float64]*Limit),
-		sellLimitsMap: make(map[float64]*Limit),
+		buyLimitsMap:  make(map[int64]*Limit),
+		sellLimitsMap: make(map[int64]*Limit),
 		Price:         0,
+		orders:        make(map[uuid.UUID]*OrderInfo),
 	}
 }
 
@@ -148,6 +172,9 @@ containing 0 orders, the user can also configure
 the name of the asset traded.
 */
 func (ob *OrderBook) Init(midPrice float64) {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
 	var (
 		l = newLimit(midPrice)
 		o = newOrder(0)
@@ -163,228 +190,498 @@ orders and limits it contains (thanks to
 the Golang garbage collector).
 */
 func (ob *OrderBook) Reset() {
-	ob.BuyLimits = []*Limit{}
-	ob.SellLimits = []*Limit{}
-	ob.buyLimitsMap = make(map[float64]*Limit)
-	ob.sellLimitsMap = make(map[float64]*Limit)
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	ob.buyTree = priceTree{}
+	ob.sellTree = priceTree{}
+	ob.buyLimitsMap = make(map[int64]*Limit)
+	ob.sellLimitsMap = make(map[int64]*Limit)
 	ob.Price = 0
+	ob.orders = make(map[uuid.UUID]*OrderInfo)
+	ob.trades = tradeRingBuffer{}
 }
 
+/*
+Returns every buy and sell limit currently in the book, buys
+ordered highest-price-first and sells lowest-price-first.
+*/
 func (ob *OrderBook) GetData() ([]*Limit, []*Limit) {
-	return ob.BuyLimits, ob.SellLimits
+	ob.mu.RLock()
+	defer ob.mu.RUnlock()
+	return ob.getData()
+}
+
+func (ob *OrderBook) getData() ([]*Limit, []*Limit) {
+	return ob.buyTree.descending(), ob.sellTree.ascending()
 }
 
 /*
-Places a limit buy or sell order at a certain Price
-and of a certain quantity. Returns the order id and
-an error if it was not possible to place it.
+Depth returns up to the top n buy and sell limits (best price
+first on each side) without copying the rest of the book.
 */
-func (ob *OrderBook) PlaceLimitOrder(buyOrder bool, Price float64, qty float64) (uuid.UUID, error) {
+func (ob *OrderBook) Depth(n int) ([]*Limit, []*Limit) {
+	ob.mu.RLock()
+	defer ob.mu.RUnlock()
+	return ob.buyTree.depth(n, true), ob.sellTree.depth(n, false)
+}
+
+/*
+bestBuy and bestSell return the best resting limit on their
+side, or nil if that side of the book is empty. Backed by the
+tree's cached min/max node, so this is O(1).
+*/
+func (ob *OrderBook) bestBuy() *Limit {
+	if ob.buyTree.max == nil {
+		return nil
+	}
+	return ob.buyTree.max.limit
+}
+
+func (ob *OrderBook) bestSell() *Limit {
+	if ob.sellTree.min == nil {
+		return nil
+	}
+	return ob.sellTree.min.limit
+}
+
+/*
+TimeInForce controls how a limit order behaves once it would
+cross the book: GTC matches whatever it can and rests the
+remainder, IOC matches whatever it can and cancels the
+remainder instead of resting it, FOK only executes if the
+whole quantity can be matched immediately and is otherwise
+rejected as a whole, and PostOnly is rejected outright if it
+would cross the book at all.
+*/
+type TimeInForce int
+
+const (
+	GTC TimeInForce = iota
+	IOC
+	FOK
+	PostOnly
+)
+
+func (tif TimeInForce) String() string {
+	switch tif {
+	case GTC:
+		return "GTC"
+	case IOC:
+		return "IOC"
+	case FOK:
+		return "FOK"
+	case PostOnly:
+		return "PostOnly"
+	default:
+		return "unknown"
+	}
+}
+
+/*
+ParseTimeInForce turns the string representation used over the
+wire into a TimeInForce, defaulting to GTC when s is empty.
+*/
+func ParseTimeInForce(s string) (TimeInForce, error) {
+	switch s {
+	case "", "GTC":
+		return GTC, nil
+	case "IOC":
+		return IOC, nil
+	case "FOK":
+		return FOK, nil
+	case "PostOnly":
+		return PostOnly, nil
+	default:
+		return GTC, fmt.Errorf("unknown time in force %q", s)
+	}
+}
+
+/*
+Places a limit buy or sell order at a certain Price and of a
+certain quantity, honoring the given TimeInForce. Returns the
+order id, the trades it triggered (if any) and an error if it
+was not possible to place it.
+*/
+func (ob *OrderBook) PlaceLimitOrder(buyOrder bool, Price float64, qty float64, tif TimeInForce) (uuid.UUID, []Trade, error) {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	return ob.placeLimitOrderLocked(buyOrder, Price, qty, tif)
+}
+
+/*
+placeLimitOrderLocked is PlaceLimitOrder's implementation, for
+callers (PlaceLimitOrders) that already hold ob.mu and need
+several orders placed under a single lock acquisition.
+*/
+func (ob *OrderBook) placeLimitOrderLocked(buyOrder bool, Price float64, qty float64, tif TimeInForce) (uuid.UUID, []Trade, error) {
 	var (
-		order         = newOrder(qty)
-		midPrice, err = ob.getMidPrice()
+		order    = newOrder(qty)
+		origQty  = qty
+		crossing = ob.crosses(buyOrder, Price)
 	)
 
-	if err != nil {
-		return order.id, err
-	} else if Price <= 0 {
-		return order.id, errors.New("can't place order if Price <= 0")
+	if Price <= 0 {
+		return order.id, nil, errors.New("can't place order if Price <= 0")
 	} else if qty <= 0 {
-		return order.id, errors.New("can't place order if quantity <= 0")
-	} else if buyOrder && Price > midPrice {
-		return order.id, errors.New("can't place a buy limit order higher than midPrice")
-	} else if !buyOrder && Price < midPrice {
-		return order.id, errors.New("can't place a sell limit order lower than midPrice")
+		return order.id, nil, errors.New("can't place order if quantity <= 0")
+	}
+
+	switch tif {
+	case PostOnly:
+		if crossing {
+			return order.id, nil, errors.New("can't place a post-only order that would cross the book")
+		}
+	case FOK:
+		if !crossing || ob.fillableQty(buyOrder, Price) < qty {
+			return order.id, nil, errors.New("can't fill order entirely, FOK order rejected")
+		}
+		trades, filled := ob.executeCross(order.id, buyOrder, qty, Price)
+		ob.recordOrder(OrderInfo{ID: order.id, BuyOrder: buyOrder, Price: Price, Qty: origQty, FilledQty: filled, Status: StatusFilled})
+		return order.id, trades, nil
+	case IOC:
+		var (
+			trades []Trade
+			filled float64
+		)
+		if crossing {
+			trades, filled = ob.executeCross(order.id, buyOrder, qty, Price)
+		}
+		status := StatusCancelled
+		switch {
+		case filled >= origQty:
+			status = StatusFilled
+		case filled > 0:
+			status = StatusPartiallyFilled
+		}
+		ob.recordOrder(OrderInfo{ID: order.id, BuyOrder: buyOrder, Price: Price, Qty: origQty, FilledQty: filled, Status: status})
+		return order.id, trades, nil
+	default: // GTC
+		if crossing {
+			trades, filled := ob.executeCross(order.id, buyOrder, qty, Price)
+			qty -= filled
+			if qty <= 0 {
+				ob.recordOrder(OrderInfo{ID: order.id, BuyOrder: buyOrder, Price: Price, Qty: origQty, FilledQty: filled, Status: StatusFilled})
+				return order.id, trades, nil
+			}
+			order.qty = qty
+			ob.insertLimitOrder(buyOrder, Price, order)
+			status := StatusOpen
+			if filled > 0 {
+				status = StatusPartiallyFilled
+			}
+			ob.recordOrder(OrderInfo{ID: order.id, BuyOrder: buyOrder, Price: Price, Qty: origQty, FilledQty: filled, Status: status})
+			ob.trimEmptyBest()
+			return order.id, trades, nil
+		}
+	}
+
+	ob.insertLimitOrder(buyOrder, Price, order)
+	ob.recordOrder(OrderInfo{ID: order.id, BuyOrder: buyOrder, Price: Price, Qty: origQty, Status: StatusOpen})
+	ob.trimEmptyBest()
+
+	return order.id, nil, nil
+}
+
+/*
+trimEmptyBest removes the best limit on either side if matching
+left it at zero Volume (it stays in the tree as an empty shell
+until the next mutation otherwise). Always dropping it, even if
+it's the last limit on that side, matters: leaving an empty
+shell around as a placeholder is what let a later order resting
+at that same Price on the other side look like a crossed
+top-of-book (best bid == best ask, one of them at zero Volume).
+getMidPrice tolerates a one-sided or empty book, so there's
+nothing left that depends on a side never going empty.
+*/
+func (ob *OrderBook) trimEmptyBest() {
+	if best := ob.bestBuy(); best != nil && best.Volume == 0 {
+		ob.deleteLimit(true, best.Price)
+	}
+	if best := ob.bestSell(); best != nil && best.Volume == 0 {
+		ob.deleteLimit(false, best.Price)
 	}
+}
+
+/*
+Adds the order to the limit sitting at Price, creating the
+limit first if the book has none there yet.
+*/
+func (ob *OrderBook) insertLimitOrder(buyOrder bool, Price float64, order *Order) {
+	tick := priceTick(Price)
 	if buyOrder {
 		// If there is no limit to place this order in.
 		// We create a new limit at the corresponding Price.
 		// We add our order to it.
 		// We add the limit to our orderbook.
-		// Finally, we sort the limits to get the highest Price 1st.
-		if ob.buyLimitsMap[Price] == nil {
+		if ob.buyLimitsMap[tick] == nil {
 			limit := newLimit(Price)
 			limit.addOrder(order)
 			ob.addLimit(true, limit)
+			ob.emit(Event{Kind: EventLimitAdded, BuyOrder: true, Price: Price})
 		} else {
-			// If there is a limit to place it.
-			// We first append it to the corresponding map.
-			// After appending a new order we need to re sort
-			// the slice to get the oldest orders 1st (FIFO).
-			// Finally we sort the orders by timestamp in the bg.
-			ob.buyLimitsMap[Price].addOrder(order)
+			// If there is a limit to place it, we just append
+			// the order to its queue (FIFO, oldest orders first).
+			ob.buyLimitsMap[tick].addOrder(order)
 		}
 	} else {
-		if ob.sellLimitsMap[Price] == nil {
+		if ob.sellLimitsMap[tick] == nil {
 			limit := newLimit(Price)
 			limit.addOrder(order)
 			ob.addLimit(false, limit)
+			ob.emit(Event{Kind: EventLimitAdded, BuyOrder: false, Price: Price})
 		} else {
-			ob.sellLimitsMap[Price].addOrder(order)
+			ob.sellLimitsMap[tick].addOrder(order)
 		}
 	}
+	ob.emit(Event{Kind: EventOrderPlaced, BuyOrder: buyOrder, Price: Price, Qty: order.qty, OrderID: order.id})
+}
 
-	if ob.canDeleteLimit(true) && ob.BuyLimits[0].Volume == 0 {
-		ob.deleteLimit(true, 0, ob.BuyLimits[0].Price)
-	} else if ob.canDeleteLimit(false) && ob.SellLimits[0].Volume == 0 {
-		ob.deleteLimit(false, 0, ob.SellLimits[0].Price)
+/*
+Returns whether a limit order of this side and Price would
+immediately match against the resting opposite side.
+*/
+func (ob *OrderBook) crosses(buyOrder bool, Price float64) bool {
+	if buyOrder {
+		best := ob.bestSell()
+		return best != nil && Price >= best.Price
 	}
-
-	return order.id, nil
+	best := ob.bestBuy()
+	return best != nil && Price <= best.Price
 }
 
 /*
-Cancels a limit order if it was not already executed.
+Returns the total resting volume on the opposite side that could
+be matched right now without going past limitPrice, without
+mutating the book.
 */
-func (ob *OrderBook) CancelLimitOrder(id uuid.UUID, Price float64) error {
-	midPrice, err := ob.getMidPrice()
-	if err != nil {
-		return err
-	}
-	// If Price is lower than midPrice, the user wants to cancel a sell order.
-	// We need to find the limit corresponding to the Price.
-	// When we find the limit, we delete the order inside of it.
-	// If limit Volume = 0 we can delete it from order book.
-	if Price < midPrice {
-		err = ob.buyLimitsMap[Price].deleteOrder(id)
-		if err != nil {
-			return err
-		}
-		if ob.canDeleteLimit(true) && ob.buyLimitsMap[Price].Volume == 0 {
-			for i, limit := range ob.BuyLimits {
-				if limit.Price == Price {
-					ob.deleteLimit(true, i, Price)
-				}
+func (ob *OrderBook) fillableQty(buyOrder bool, limitPrice float64) float64 {
+	total := 0.0
+	if buyOrder {
+		for _, l := range ob.sellTree.ascending() {
+			if l.Price > limitPrice {
+				break
 			}
+			total += l.Volume
 		}
-		return nil
 	} else {
-		err = ob.sellLimitsMap[Price].deleteOrder(id)
-		if err != nil {
-			return err
-		}
-		if ob.canDeleteLimit(false) && ob.sellLimitsMap[Price].Volume == 0 {
-			for i, limit := range ob.SellLimits {
-				if limit.Price == Price {
-					fmt.Println(i)
-					ob.deleteLimit(false, i, Price)
-				}
+		for _, l := range ob.buyTree.descending() {
+			if l.Price < limitPrice {
+				break
 			}
+			total += l.Volume
 		}
-		return nil
 	}
+	return total
 }
 
 /*
-Executes a market buy or sell order of a certain
-quantity that must be <= than the order-book total
-buy or sell limits Volume.
+Matches qty against the opposite side of the book, never
+trading through limitPrice, one resting order at a time so each
+fill can be reported as a Trade naming its maker. Returns the
+trades produced and how much of qty was filled.
 */
-func (ob *OrderBook) PlaceMarketOrder(buyOrder bool, qty float64) error {
-	// First, we delete the limits entirely while we can fill them.
-	// Then, we delete the limit orders entirely while we can fill them.
-	// Finally, we fill the last limit order partially.
-	if qty <= 0 {
-		return errors.New("error, market order qty <= 0")
-	}
-	if buyOrder {
-		if qty >= ob.getTotalVolume(false) {
-			return errors.New("can't execute market order : order qty > total Volume")
-		}
-		for len(ob.SellLimits) > 0 && qty >= ob.SellLimits[0].Volume {
-			qty -= ob.SellLimits[0].Volume
-			ob.Price = ob.SellLimits[0].Price
-			ob.deleteLimit(false, 0, ob.SellLimits[0].Price)
+func (ob *OrderBook) executeCross(takerID uuid.UUID, buyOrder bool, qty float64, limitPrice float64) ([]Trade, float64) {
+	var trades []Trade
+	filled := 0.0
+
+	best := func() *Limit {
+		if buyOrder {
+			return ob.bestSell()
 		}
-		for len(ob.SellLimits) > 0 && qty >= ob.SellLimits[0].orders.front.qty {
-			ob.Price = ob.SellLimits[0].Price
-			ob.SellLimits[0].Volume -= ob.SellLimits[0].orders.front.qty
-			qty -= ob.SellLimits[0].orders.front.qty
-			ob.SellLimits[0].orders.front = ob.SellLimits[0].orders.front.next
+		return ob.bestBuy()
+	}
+	withinLimit := func(l *Limit) bool {
+		if buyOrder {
+			return l.Price <= limitPrice
 		}
-		if qty != 0 {
-			ob.Price = ob.SellLimits[0].Price
-			ob.SellLimits[0].orders.front.qty -= qty
-			ob.SellLimits[0].Volume -= qty
+		return l.Price >= limitPrice
+	}
+
+	for qty > 0 {
+		limit := best()
+		if limit == nil || limit.orders.front == nil || !withinLimit(limit) {
+			break
 		}
-	} else {
-		if qty >= ob.getTotalVolume(true) {
-			return errors.New("can't execute market order : order qty > total Volume")
+
+		maker := limit.orders.front
+		if maker.qty <= 0 {
+			// Placeholder order (Init seeds each side with one of
+			// these so getMidPrice has something to work with
+			// before any real quote exists): nothing to trade
+			// against, just drop it from the queue and keep going.
+			limit.orders.front = maker.next
+			if limit.orders.front == nil {
+				limit.orders.rear = nil
+				ob.deleteLimit(!buyOrder, limit.Price)
+			}
+			continue
 		}
-		for len(ob.BuyLimits) > 0 && qty >= ob.BuyLimits[0].Volume {
-			qty -= ob.BuyLimits[0].Volume
-			ob.Price = ob.BuyLimits[0].Price
-			ob.deleteLimit(true, 0, ob.BuyLimits[0].Price)
+		matched := math.Min(qty, maker.qty)
+
+		ob.Price = limit.Price
+		trade := Trade{
+			MakerID:      maker.id,
+			TakerID:      takerID,
+			Price:        limit.Price,
+			Qty:          matched,
+			Timestamp:    time.Now().UnixNano(),
+			AggressorBuy: buyOrder,
 		}
-		for len(ob.BuyLimits) > 0 && qty >= ob.BuyLimits[0].orders.front.qty {
-			ob.Price = ob.BuyLimits[0].Price
-			ob.BuyLimits[0].Volume -= ob.BuyLimits[0].orders.front.qty
-			qty -= ob.BuyLimits[0].orders.front.qty
-			ob.BuyLimits[0].orders.front = ob.BuyLimits[0].orders.front.next
+		ob.trades.push(trade)
+		ob.fillOrder(maker.id, matched)
+		trades = append(trades, trade)
+		ob.emit(Event{Kind: EventTradeExecuted, BuyOrder: buyOrder, Price: limit.Price, Qty: matched})
+
+		maker.qty -= matched
+		limit.Volume -= matched
+		qty -= matched
+		filled += matched
+
+		if maker.qty <= 0 {
+			limit.orders.front = maker.next
 		}
-		if qty != 0 {
-			ob.Price = ob.BuyLimits[0].Price
-			ob.BuyLimits[0].orders.front.qty -= qty
-			ob.BuyLimits[0].Volume -= qty
+		if limit.orders.front == nil {
+			// Clear rear too: Init seeds one Limit shared by both
+			// buyLimitsMap and sellLimitsMap, so deleting it from
+			// this side's tree/map leaves the same *Limit object
+			// still reachable from the other side. If its rear
+			// pointer were left dangling, a later addOrder on that
+			// surviving reference would link behind it instead of
+			// behind front, silently losing the new order.
+			limit.orders.rear = nil
+			ob.deleteLimit(!buyOrder, limit.Price)
 		}
 	}
+
+	return trades, filled
+}
+
+/*
+Cancels a limit order if it was not already executed.
+*/
+func (ob *OrderBook) CancelLimitOrder(id uuid.UUID, Price float64) error {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	return ob.cancelLimitOrderLocked(id, Price)
+}
+
+/*
+cancelLimitOrderLocked is CancelLimitOrder's implementation, for
+callers (CancelLimitOrders) that already hold ob.mu and need
+several orders cancelled under a single lock acquisition.
+*/
+func (ob *OrderBook) cancelLimitOrderLocked(id uuid.UUID, Price float64) error {
+	info, ok := ob.orders[id]
+	if !ok {
+		return errors.New("no order with this id")
+	}
+	buyOrder := info.BuyOrder
+	tick := priceTick(Price)
+	// We look up the order's own recorded side instead of
+	// comparing Price against the midPrice: a resting GTC
+	// remainder can end up on either side of the current
+	// midPrice (e.g. a buy resting above it after a partial
+	// fill moved the book), so inferring side from Price would
+	// route the cancel to the wrong map and fail to find it.
+	limits := ob.sellLimitsMap
+	if buyOrder {
+		limits = ob.buyLimitsMap
+	}
+	limit, ok := limits[tick]
+	if !ok {
+		return errors.New("no limit at this price")
+	}
+	if err := limit.deleteOrder(id); err != nil {
+		return err
+	}
+	ob.cancelOrder(id)
+	ob.emit(Event{Kind: EventOrderCancelled, BuyOrder: buyOrder, Price: Price, OrderID: id})
+	if limit.Volume == 0 {
+		ob.deleteLimit(buyOrder, Price)
+	}
 	return nil
 }
 
 /*
-Add the limit to the order-book and re-sorts
-the slice.
+Executes a market buy or sell order of a certain quantity that
+must be strictly less than the opposite side's total Volume.
+Returns the taker id (so its fills can be queried through
+GetOrder) and the trades it triggered.
 */
-func (ob *OrderBook) addLimit(buyLimit bool, l *Limit) {
-	if buyLimit {
-		ob.buyLimitsMap[l.Price] = l
-		ob.BuyLimits = append(ob.BuyLimits, l)
-		sort.Sort(byHighestPrice(ob.BuyLimits))
+func (ob *OrderBook) PlaceMarketOrder(buyOrder bool, qty float64) (uuid.UUID, []Trade, error) {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	taker := uuid.New()
+	if qty <= 0 {
+		return taker, nil, errors.New("error, market order qty <= 0")
+	}
+	var (
+		trades []Trade
+		filled float64
+	)
+	if buyOrder {
+		if qty >= ob.getTotalVolume(false) {
+			return taker, nil, errors.New("can't execute market order : order qty >= total Volume")
+		}
+		trades, filled = ob.executeCross(taker, true, qty, math.Inf(1))
 	} else {
-		ob.sellLimitsMap[l.Price] = l
-		ob.SellLimits = append(ob.SellLimits, l)
-		sort.Sort(byLowestPrice(ob.SellLimits))
+		if qty >= ob.getTotalVolume(true) {
+			return taker, nil, errors.New("can't execute market order : order qty >= total Volume")
+		}
+		trades, filled = ob.executeCross(taker, false, qty, math.Inf(-1))
 	}
+	ob.recordOrder(OrderInfo{ID: taker, BuyOrder: buyOrder, Qty: qty, FilledQty: filled, Status: StatusFilled})
+	return taker, trades, nil
 }
 
 /*
-We must not delete a limit if it's the last remaining
-in the corresponding slice, because it would break
-the getMidPrice function.
+Add the limit to the order-book's tree for that side.
 */
-func (ob *OrderBook) canDeleteLimit(buyLimit bool) bool {
+func (ob *OrderBook) addLimit(buyLimit bool, l *Limit) {
+	tick := priceTick(l.Price)
 	if buyLimit {
-		return len(ob.BuyLimits) > 1
+		ob.buyLimitsMap[tick] = l
+		ob.buyTree.insert(tick, l)
+	} else {
+		ob.sellLimitsMap[tick] = l
+		ob.sellTree.insert(tick, l)
 	}
-	return len(ob.SellLimits) > 1
 }
 
 /*
-Deletes the limit and re-sorts the slice.
+Deletes the limit sitting at Price from the order-book's tree.
 */
-func (ob *OrderBook) deleteLimit(buyLimit bool, pos int, Price float64) {
+func (ob *OrderBook) deleteLimit(buyLimit bool, Price float64) {
+	tick := priceTick(Price)
 	if buyLimit {
-		ob.BuyLimits[pos] = ob.BuyLimits[len(ob.BuyLimits)-1]
-		ob.BuyLimits = ob.BuyLimits[:len(ob.BuyLimits)-1]
-		delete(ob.buyLimitsMap, Price)
-		sort.Sort(byHighestPrice(ob.BuyLimits))
+		ob.buyTree.delete(tick)
+		delete(ob.buyLimitsMap, tick)
 	} else {
-		ob.SellLimits[pos] = ob.SellLimits[len(ob.SellLimits)-1]
-		ob.SellLimits = ob.SellLimits[:len(ob.SellLimits)-1]
-		delete(ob.sellLimitsMap, Price)
-		sort.Sort(byLowestPrice(ob.SellLimits))
+		ob.sellTree.delete(tick)
+		delete(ob.sellLimitsMap, tick)
 	}
+	ob.emit(Event{Kind: EventLimitRemoved, BuyOrder: buyLimit, Price: Price})
 }
 
 /*
-Returns the order-book midPrice, it needs
-to have at least one buy and sell limit to work.
+Returns the order-book midPrice. Falls back to whichever side
+has a best limit if the book is one-sided, and only errors if
+it has no buy or sell limits at all.
 */
 func (ob *OrderBook) getMidPrice() (float64, error) {
-	if len(ob.BuyLimits) > 0 && len(ob.SellLimits) > 0 {
-		return (ob.BuyLimits[0].Price + ob.SellLimits[0].Price) / 2, nil
+	buy, sell := ob.bestBuy(), ob.bestSell()
+	switch {
+	case buy != nil && sell != nil:
+		return (buy.Price + sell.Price) / 2, nil
+	case buy != nil:
+		return buy.Price, nil
+	case sell != nil:
+		return sell.Price, nil
+	default:
+		return 0.0, errors.New("order-book has 0 buy or sell limits")
 	}
-	return 0.0, errors.New("order-book as 0 buy or sell limits")
 }
 
 /*
@@ -392,11 +689,11 @@ Returns the order-book spread, it needs to
 have at least one buy and sell limit to work.
 */
 func (ob *OrderBook) getSpread() (float64, error) {
-	if len(ob.BuyLimits) > 0 && len(ob.SellLimits) > 0 {
-		return (ob.SellLimits[0].Price - ob.BuyLimits[0].Price), nil
-	} else {
-		return 0.0, nil
+	buy, sell := ob.bestBuy(), ob.bestSell()
+	if buy != nil && sell != nil {
+		return sell.Price - buy.Price, nil
 	}
+	return 0.0, nil
 }
 
 /*
@@ -405,53 +702,24 @@ Returns the market buy or sell limits total Volume.
 func (ob *OrderBook) getTotalVolume(buyLimits bool) float64 {
 	totalVol := 0.0
 	if buyLimits {
-		for _, limit := range ob.BuyLimits {
+		for _, limit := range ob.buyTree.ascending() {
 			totalVol += limit.Volume
 		}
 	} else {
-		for _, limit := range ob.SellLimits {
+		for _, limit := range ob.sellTree.ascending() {
 			totalVol += limit.Volume
 		}
 	}
 	return totalVol
 }
 
-// Sorting Limits
-
-type byLowestPrice []*Limit
-
-func (limits byLowestPrice) Len() int {
-	return len(limits)
-}
-
-func (limits byLowestPrice) Swap(i, j int) {
-	limits[i], limits[j] = limits[j], limits[i]
-}
-
-func (limits byLowestPrice) Less(i, j int) bool {
-	return limits[i].Price < limits[j].Price
-}
-
-//
-
-type byHighestPrice []*Limit
-
-func (limits byHighestPrice) Len() int {
-	return len(limits)
-}
-
-func (limits byHighestPrice) Swap(i, j int) {
-	limits[i], limits[j] = limits[j], limits[i]
-}
-
-func (limits byHighestPrice) Less(i, j int) bool {
-	return limits[i].Price > limits[j].Price
-}
-
 // Printing
 
 func (ob *OrderBook) String() string {
-	return fmt.Sprintf("\nORDER BOOK\nBUYS %+v \nSELLS %+v \nBMAP %+v \nSMAP %+v \nPrice %.2f\n", ob.BuyLimits, ob.SellLimits, ob.buyLimitsMap, ob.sellLimitsMap, ob.Price)
+	ob.mu.RLock()
+	defer ob.mu.RUnlock()
+	buy, sell := ob.getData()
+	return fmt.Sprintf("\nORDER BOOK\nBUYS %+v \nSELLS %+v \nBMAP %+v \nSMAP %+v \nPrice %.2f\n", buy, sell, ob.buyLimitsMap, ob.sellLimitsMap, ob.Price)
 }
 
 func (o *Order) String() string {
@@ -0,0 +1,87 @@
+package orderbook
+
+import "github.com/google/uuid"
+
+/*
+OrderStatus is the lifecycle state of an order placed through
+PlaceLimitOrder or PlaceMarketOrder.
+*/
+type OrderStatus int
+
+const (
+	StatusOpen OrderStatus = iota
+	StatusPartiallyFilled
+	StatusFilled
+	StatusCancelled
+)
+
+func (s OrderStatus) String() string {
+	switch s {
+	case StatusOpen:
+		return "open"
+	case StatusPartiallyFilled:
+		return "partially_filled"
+	case StatusFilled:
+		return "filled"
+	case StatusCancelled:
+		return "cancelled"
+	default:
+		return "unknown"
+	}
+}
+
+/*
+OrderInfo reports the current state of a previously placed
+order: its side, Price (0 for market orders), original quantity
+and how much of it has been filled so far.
+*/
+type OrderInfo struct {
+	ID        uuid.UUID
+	BuyOrder  bool
+	Price     float64
+	Qty       float64
+	FilledQty float64
+	Status    OrderStatus
+}
+
+func (ob *OrderBook) recordOrder(info OrderInfo) {
+	ob.orders[info.ID] = &info
+}
+
+/*
+fillOrder is called by executeCross for the maker side of a
+trade to keep that order's OrderInfo in sync with its fills.
+*/
+func (ob *OrderBook) fillOrder(id uuid.UUID, qty float64) {
+	info, ok := ob.orders[id]
+	if !ok {
+		return
+	}
+	info.FilledQty += qty
+	if info.FilledQty >= info.Qty {
+		info.Status = StatusFilled
+	} else {
+		info.Status = StatusPartiallyFilled
+	}
+}
+
+func (ob *OrderBook) cancelOrder(id uuid.UUID) {
+	if info, ok := ob.orders[id]; ok && info.Status != StatusFilled {
+		info.Status = StatusCancelled
+	}
+}
+
+/*
+GetOrder returns the current status and cumulative filled
+quantity of the order with this id, or ok == false if no such
+order is known to the book.
+*/
+func (ob *OrderBook) GetOrder(id uuid.UUID) (info OrderInfo, ok bool) {
+	ob.mu.RLock()
+	defer ob.mu.RUnlock()
+	rec, ok := ob.orders[id]
+	if !ok {
+		return OrderInfo{}, false
+	}
+	return *rec, true
+}
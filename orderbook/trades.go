@@ -0,0 +1,71 @@
+package orderbook
+
+import "github.com/google/uuid"
+
+/*
+Trade records one match between a resting (maker) order and an
+incoming (taker) order: who provided the liquidity, who took
+it, at what price, for what quantity, and which side was the
+aggressor.
+*/
+type Trade struct {
+	MakerID      uuid.UUID
+	TakerID      uuid.UUID
+	Price        float64
+	Qty          float64
+	Timestamp    int64
+	AggressorBuy bool
+}
+
+// tradeHistorySize bounds how many recent trades /trades can
+// serve, oldest dropped first.
+const tradeHistorySize = 1024
+
+/*
+tradeRingBuffer keeps the last tradeHistorySize trades so
+/trades doesn't need to retain the book's entire history.
+*/
+type tradeRingBuffer struct {
+	trades [tradeHistorySize]Trade
+	next   int
+	filled bool
+}
+
+func (r *tradeRingBuffer) push(t Trade) {
+	r.trades[r.next] = t
+	r.next = (r.next + 1) % tradeHistorySize
+	if r.next == 0 {
+		r.filled = true
+	}
+}
+
+/*
+since returns every recorded trade with Timestamp >= ts,
+oldest first.
+*/
+func (r *tradeRingBuffer) since(ts int64) []Trade {
+	count := r.next
+	start := 0
+	if r.filled {
+		count = tradeHistorySize
+		start = r.next
+	}
+	result := make([]Trade, 0, count)
+	for i := 0; i < count; i++ {
+		t := r.trades[(start+i)%tradeHistorySize]
+		if t.Timestamp >= ts {
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+/*
+Trades returns the recorded trades with Timestamp >= since,
+oldest first. Pass 0 to get everything still retained.
+*/
+func (ob *OrderBook) Trades(since int64) []Trade {
+	ob.mu.RLock()
+	defer ob.mu.RUnlock()
+	return ob.trades.since(since)
+}
@@ -0,0 +1,256 @@
+package orderbook
+
+import "math"
+
+/*
+priceTickScale fixes prices to 8 decimal places before using
+them as tree/map keys, so that a price drifting to something
+like 100.099999999999 after arithmetic doesn't compare or hash
+differently from a price that was always exactly 100.10.
+*/
+const priceTickScale = 1e8
+
+func priceTick(price float64) int64 {
+	return int64(math.Round(price * priceTickScale))
+}
+
+func tickPrice(tick int64) float64 {
+	return float64(tick) / priceTickScale
+}
+
+/*
+avlNode is a node of the self-balancing binary search tree that
+keeps a side of the book ordered by price tick.
+*/
+type avlNode struct {
+	tick        int64
+	limit       *Limit
+	left, right *avlNode
+	height      int
+}
+
+func height(n *avlNode) int {
+	if n == nil {
+		return 0
+	}
+	return n.height
+}
+
+func balanceFactor(n *avlNode) int {
+	if n == nil {
+		return 0
+	}
+	return height(n.left) - height(n.right)
+}
+
+func updateHeight(n *avlNode) {
+	n.height = 1 + max(height(n.left), height(n.right))
+}
+
+func rotateRight(n *avlNode) *avlNode {
+	l := n.left
+	n.left = l.right
+	l.right = n
+	updateHeight(n)
+	updateHeight(l)
+	return l
+}
+
+func rotateLeft(n *avlNode) *avlNode {
+	r := n.right
+	n.right = r.left
+	r.left = n
+	updateHeight(n)
+	updateHeight(r)
+	return r
+}
+
+func rebalance(n *avlNode) *avlNode {
+	updateHeight(n)
+	switch bf := balanceFactor(n); {
+	case bf > 1:
+		if balanceFactor(n.left) < 0 {
+			n.left = rotateLeft(n.left)
+		}
+		return rotateRight(n)
+	case bf < -1:
+		if balanceFactor(n.right) > 0 {
+			n.right = rotateRight(n.right)
+		}
+		return rotateLeft(n)
+	default:
+		return n
+	}
+}
+
+/*
+priceTree is a price-ordered AVL tree holding one side of the
+book, with cached pointers to its minimum and maximum node so
+the best price on that side is an O(1) lookup instead of a
+tree walk.
+*/
+type priceTree struct {
+	root     *avlNode
+	count    int
+	min, max *avlNode
+}
+
+func (t *priceTree) insert(tick int64, l *Limit) {
+	var inserted bool
+	t.root, inserted = insertNode(t.root, tick, l)
+	if inserted {
+		t.count++
+	}
+	t.refreshMinMax()
+}
+
+func insertNode(n *avlNode, tick int64, l *Limit) (*avlNode, bool) {
+	if n == nil {
+		return &avlNode{tick: tick, limit: l, height: 1}, true
+	}
+	var inserted bool
+	switch {
+	case tick < n.tick:
+		n.left, inserted = insertNode(n.left, tick, l)
+	case tick > n.tick:
+		n.right, inserted = insertNode(n.right, tick, l)
+	default:
+		n.limit = l
+		return n, false
+	}
+	return rebalance(n), inserted
+}
+
+func (t *priceTree) delete(tick int64) {
+	var deleted bool
+	t.root, deleted = deleteNode(t.root, tick)
+	if deleted {
+		t.count--
+	}
+	t.refreshMinMax()
+}
+
+func deleteNode(n *avlNode, tick int64) (*avlNode, bool) {
+	if n == nil {
+		return nil, false
+	}
+	var deleted bool
+	switch {
+	case tick < n.tick:
+		n.left, deleted = deleteNode(n.left, tick)
+	case tick > n.tick:
+		n.right, deleted = deleteNode(n.right, tick)
+	default:
+		deleted = true
+		if n.left == nil {
+			return n.right, true
+		}
+		if n.right == nil {
+			return n.left, true
+		}
+		succ := n.right
+		for succ.left != nil {
+			succ = succ.left
+		}
+		n.tick, n.limit = succ.tick, succ.limit
+		n.right, _ = deleteNode(n.right, succ.tick)
+	}
+	if n == nil {
+		return nil, deleted
+	}
+	return rebalance(n), deleted
+}
+
+func (t *priceTree) refreshMinMax() {
+	if t.root == nil {
+		t.min, t.max = nil, nil
+		return
+	}
+	n := t.root
+	for n.left != nil {
+		n = n.left
+	}
+	t.min = n
+	n = t.root
+	for n.right != nil {
+		n = n.right
+	}
+	t.max = n
+}
+
+func (t *priceTree) find(tick int64) *Limit {
+	n := t.root
+	for n != nil {
+		switch {
+		case tick == n.tick:
+			return n.limit
+		case tick < n.tick:
+			n = n.left
+		default:
+			n = n.right
+		}
+	}
+	return nil
+}
+
+// ascending returns every limit in the tree ordered from lowest
+// to highest price.
+func (t *priceTree) ascending() []*Limit {
+	limits := make([]*Limit, 0, t.count)
+	var walk func(*avlNode)
+	walk = func(n *avlNode) {
+		if n == nil {
+			return
+		}
+		walk(n.left)
+		limits = append(limits, n.limit)
+		walk(n.right)
+	}
+	walk(t.root)
+	return limits
+}
+
+// descending returns every limit in the tree ordered from
+// highest to lowest price.
+func (t *priceTree) descending() []*Limit {
+	limits := make([]*Limit, 0, t.count)
+	var walk func(*avlNode)
+	walk = func(n *avlNode) {
+		if n == nil {
+			return
+		}
+		walk(n.right)
+		limits = append(limits, n.limit)
+		walk(n.left)
+	}
+	walk(t.root)
+	return limits
+}
+
+// depth returns up to n limits ordered from best to worst price,
+// without walking the rest of the tree once n are collected.
+// best selects which end of the tree is "best": descending from
+// the max node for buys, ascending from the min node for sells.
+func (t *priceTree) depth(n int, best bool) []*Limit {
+	limits := make([]*Limit, 0, n)
+	var walk func(*avlNode) bool
+	walk = func(node *avlNode) bool {
+		if node == nil || len(limits) >= n {
+			return len(limits) >= n
+		}
+		first, second := node.left, node.right
+		if best {
+			first, second = node.right, node.left
+		}
+		if walk(first) {
+			return true
+		}
+		limits = append(limits, node.limit)
+		if len(limits) >= n {
+			return true
+		}
+		return walk(second)
+	}
+	walk(t.root)
+	return limits
+}
@@ -3,9 +3,11 @@ package server
 import (
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/mrochk/exchange/execution"
 	"github.com/mrochk/exchange/orderbook"
 )
 
@@ -19,9 +21,10 @@ func handleInit(c *gin.Context) (InitParams, error) {
 }
 
 type LimitOrderParams struct {
-	Type  bool    `json:"type"`
-	Price float64 `json:"price"`
-	Qty   float64 `json:"qty"`
+	Type        bool    `json:"type"`
+	Price       float64 `json:"price"`
+	Qty         float64 `json:"qty"`
+	TimeInForce string  `json:"time_in_force"`
 }
 
 func handleLimitOrder(c *gin.Context) (LimitOrderParams, error) {
@@ -39,6 +42,24 @@ func handleCancelOrder(c *gin.Context) (CancelOrderParams, error) {
 	return params, c.BindJSON(&params)
 }
 
+type BatchLimitOrderParams struct {
+	Orders []LimitOrderParams `json:"orders"`
+}
+
+func handleBatchLimitOrder(c *gin.Context) (BatchLimitOrderParams, error) {
+	var params BatchLimitOrderParams
+	return params, c.BindJSON(&params)
+}
+
+type BatchCancelOrderParams struct {
+	Orders []CancelOrderParams `json:"orders"`
+}
+
+func handleBatchCancelOrder(c *gin.Context) (BatchCancelOrderParams, error) {
+	var params BatchCancelOrderParams
+	return params, c.BindJSON(&params)
+}
+
 type MarketOrderParams struct {
 	Type bool    `json:"type"`
 	Qty  float64 `json:"qty"`
@@ -49,6 +70,18 @@ func handleMarketOrder(c *gin.Context) (MarketOrderParams, error) {
 	return params, c.BindJSON(&params)
 }
 
+type TWAPOrderParams struct {
+	Type     bool    `json:"type"`
+	Qty      float64 `json:"qty"`
+	Slices   int     `json:"slices"`
+	Duration string  `json:"duration"` // whole execution window, split evenly across slices; parsed with time.ParseDuration, e.g. "30s"
+}
+
+func handleTWAPOrder(c *gin.Context) (TWAPOrderParams, error) {
+	var params TWAPOrderParams
+	return params, c.BindJSON(&params)
+}
+
 type LimitData struct {
 	Price  float64 `json:"price"`
 	Volume float64 `json:"volume"`
@@ -73,6 +106,12 @@ func New(ob *orderbook.OrderBook) *gin.Engine {
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.Default()
 
+	hub := newWSHub()
+	ob.SetEventSink(hub.broadcast)
+	router.GET("/ws", handleWS(hub))
+
+	twaps := execution.NewManager(ob)
+
 	router.POST("/init", func(ctx *gin.Context) {
 		p, err := handleInit(ctx)
 		if err == nil {
@@ -83,12 +122,19 @@ func New(ob *orderbook.OrderBook) *gin.Engine {
 	router.POST("/limit_order", func(ctx *gin.Context) {
 		p, err := handleLimitOrder(ctx)
 		if err == nil {
-			id, err := ob.PlaceLimitOrder(p.Type, p.Price, p.Qty)
+			tif, err := orderbook.ParseTimeInForce(p.TimeInForce)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			id, trades, err := ob.PlaceLimitOrder(p.Type, p.Price, p.Qty, tif)
 			if err == nil {
 				var resp struct {
-					ID uuid.UUID `json:"order_id"`
+					ID     uuid.UUID         `json:"order_id"`
+					Trades []orderbook.Trade `json:"trades"`
 				}
 				resp.ID = id
+				resp.Trades = trades
 				ctx.JSON(http.StatusOK, resp)
 			} else {
 				fmt.Println(err)
@@ -106,25 +152,158 @@ func New(ob *orderbook.OrderBook) *gin.Engine {
 		}
 	})
 
+	router.POST("/batch_limit_order", func(ctx *gin.Context) {
+		p, err := handleBatchLimitOrder(ctx)
+		if err != nil {
+			return
+		}
+		reqs := make([]orderbook.LimitOrderReq, len(p.Orders))
+		for i, o := range p.Orders {
+			tif, err := orderbook.ParseTimeInForce(o.TimeInForce)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			reqs[i] = orderbook.LimitOrderReq{BuyOrder: o.Type, Price: o.Price, Qty: o.Qty, TimeInForce: tif}
+		}
+		ids, trades, errs := ob.PlaceLimitOrders(reqs)
+		var resp struct {
+			IDs    []uuid.UUID         `json:"order_ids"`
+			Trades [][]orderbook.Trade `json:"trades"`
+			Errors []string            `json:"errors"`
+		}
+		resp.IDs = ids
+		resp.Trades = trades
+		resp.Errors = make([]string, len(errs))
+		for i, e := range errs {
+			if e != nil {
+				resp.Errors[i] = e.Error()
+			}
+		}
+		ctx.JSON(http.StatusOK, resp)
+	})
+
+	router.POST("/batch_cancel_order", func(ctx *gin.Context) {
+		p, err := handleBatchCancelOrder(ctx)
+		if err != nil {
+			return
+		}
+		reqs := make([]orderbook.CancelReq, len(p.Orders))
+		for i, o := range p.Orders {
+			reqs[i] = orderbook.CancelReq{ID: o.ID, Price: o.Price}
+		}
+		errs := ob.CancelLimitOrders(reqs)
+		resp := make([]string, len(errs))
+		for i, e := range errs {
+			if e != nil {
+				resp[i] = e.Error()
+			}
+		}
+		ctx.JSON(http.StatusOK, gin.H{"errors": resp})
+	})
+
 	router.POST("/market_order", func(ctx *gin.Context) {
 		p, err := handleMarketOrder(ctx)
 		if err == nil {
-			err := ob.PlaceMarketOrder(p.Type, p.Qty)
-			if err != nil {
+			id, trades, err := ob.PlaceMarketOrder(p.Type, p.Qty)
+			if err == nil {
+				var resp struct {
+					ID     uuid.UUID         `json:"order_id"`
+					Trades []orderbook.Trade `json:"trades"`
+				}
+				resp.ID = id
+				resp.Trades = trades
+				ctx.JSON(http.StatusOK, resp)
+			} else {
 				fmt.Println(err)
 			}
 		}
 	})
 
+	router.GET("/trades", func(ctx *gin.Context) {
+		var since int64
+		if s := ctx.Query("since"); s != "" {
+			if _, err := fmt.Sscanf(s, "%d", &since); err != nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid since"})
+				return
+			}
+		}
+		ctx.JSON(http.StatusOK, gin.H{"trades": ob.Trades(since)})
+	})
+
+	router.GET("/order/:id", func(ctx *gin.Context) {
+		id, err := uuid.Parse(ctx.Param("id"))
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid order id"})
+			return
+		}
+		info, ok := ob.GetOrder(id)
+		if !ok {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+			return
+		}
+		ctx.JSON(http.StatusOK, info)
+	})
+
+	router.POST("/twap", func(ctx *gin.Context) {
+		p, err := handleTWAPOrder(ctx)
+		if err != nil {
+			return
+		}
+		duration, err := time.ParseDuration(p.Duration)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid duration"})
+			return
+		}
+		interval := duration
+		if p.Slices > 0 {
+			interval = duration / time.Duration(p.Slices)
+		}
+		exec, err := twaps.Start(p.Type, p.Qty, p.Slices, interval)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"id": exec.ID()})
+	})
+
+	router.GET("/twap/:id", func(ctx *gin.Context) {
+		id, err := uuid.Parse(ctx.Param("id"))
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid twap id"})
+			return
+		}
+		exec, ok := twaps.Get(id)
+		if !ok {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "twap not found"})
+			return
+		}
+		ctx.JSON(http.StatusOK, exec.Snapshot())
+	})
+
+	router.DELETE("/twap/:id", func(ctx *gin.Context) {
+		id, err := uuid.Parse(ctx.Param("id"))
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid twap id"})
+			return
+		}
+		if !twaps.Cancel(id) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "twap not found"})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"status": "cancelled"})
+	})
+
 	router.GET("/get_data", func(ctx *gin.Context) {
 		var limitData LimitData
 		d := newData()
-		for _, limit := range ob.BuyLimits {
+		buyLimits, sellLimits := ob.GetData()
+		for _, limit := range buyLimits {
 			limitData.Price = limit.Price
 			limitData.Volume = limit.Volume
 			d.BuyLimitsData = append(d.BuyLimitsData, limitData)
 		}
-		for _, limit := range ob.SellLimits {
+		for _, limit := range sellLimits {
 			limitData.Price = limit.Price
 			limitData.Volume = limit.Volume
 			d.SellLimitsData = append(d.SellLimitsData, limitData)
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/mrochk/exchange/orderbook"
+)
+
+// clientSendBuffer is how many pending events a client can have
+// queued before it is considered a slow consumer and evicted.
+const clientSendBuffer = 64
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin:     func(r *http.Request) bool { return true },
+}
+
+/*
+wsHub fans out order-book events to every subscribed WebSocket
+client, each through its own buffered channel so one slow
+client can't block the others.
+*/
+type wsHub struct {
+	mu      sync.Mutex
+	clients map[chan orderbook.Event]*websocket.Conn
+}
+
+func newWSHub() *wsHub {
+	return &wsHub{clients: make(map[chan orderbook.Event]*websocket.Conn)}
+}
+
+func (h *wsHub) register(conn *websocket.Conn) chan orderbook.Event {
+	ch := make(chan orderbook.Event, clientSendBuffer)
+	h.mu.Lock()
+	h.clients[ch] = conn
+	h.mu.Unlock()
+	return ch
+}
+
+func (h *wsHub) unregister(ch chan orderbook.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if conn, ok := h.clients[ch]; ok {
+		conn.Close()
+		delete(h.clients, ch)
+		close(ch)
+	}
+}
+
+/*
+broadcast fans e out to every client's buffered channel. A
+client whose channel is already full is considered a slow
+consumer and is evicted instead of being allowed to block the
+event sink.
+*/
+func (h *wsHub) broadcast(e orderbook.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch, conn := range h.clients {
+		select {
+		case ch <- e:
+		default:
+			log.Println("ws: evicting slow consumer")
+			conn.Close()
+			delete(h.clients, ch)
+			close(ch)
+		}
+	}
+}
+
+/*
+writeLoop drains ch and writes each event to conn as JSON until
+the channel is closed or the write fails.
+*/
+func (h *wsHub) writeLoop(conn *websocket.Conn, ch chan orderbook.Event) {
+	for e := range ch {
+		if err := conn.WriteJSON(e); err != nil {
+			h.unregister(ch)
+			return
+		}
+	}
+}
+
+/*
+handleWS upgrades the request to a WebSocket and streams book
+events to it until the client disconnects.
+*/
+func handleWS(hub *wsHub) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		conn, err := upgrader.Upgrade(ctx.Writer, ctx.Request, nil)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		ch := hub.register(conn)
+		go hub.writeLoop(conn, ch)
+		go hub.readLoop(conn, ch)
+	}
+}
+
+/*
+readLoop discards any message sent by the client but keeps
+reading so gorilla delivers control frames (ping/close); once
+the connection errors out the client is unregistered.
+*/
+func (h *wsHub) readLoop(conn *websocket.Conn, ch chan orderbook.Event) {
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			h.unregister(ch)
+			return
+		}
+	}
+}